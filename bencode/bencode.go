@@ -0,0 +1,363 @@
+// Package bencode implements encoding and decoding of the bencode format
+// used throughout the BitTorrent protocol, for metainfo files and for the
+// tracker and peer-exchange messages built on top of it.
+package bencode
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Marshaler is implemented by types that encode themselves directly to a
+// complete bencoded value, such as util.CompactPeers encoding itself as a
+// single bencode string of packed addresses rather than a list.
+type Marshaler interface {
+	MarshalBencode() ([]byte, error)
+}
+
+// Unmarshaler is implemented by types that decode themselves from the raw
+// bytes of a bencoded string.
+type Unmarshaler interface {
+	UnmarshalBencode([]byte) error
+}
+
+// Marshal returns the bencoded encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	return marshalValue(reflect.ValueOf(v))
+}
+
+func marshalValue(v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return []byte("0:"), nil
+	}
+	if m, ok := v.Interface().(Marshaler); ok {
+		return m.MarshalBencode()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return marshalRawString(v.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []byte(fmt.Sprintf("i%de", v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []byte(fmt.Sprintf("i%de", v.Uint())), nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return marshalRawBytes(b), nil
+		}
+		out := []byte{'l'}
+		for i := 0; i < v.Len(); i++ {
+			e, err := marshalValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, e...)
+		}
+		return append(out, 'e'), nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return []byte("0:"), nil
+		}
+		return marshalValue(v.Elem())
+	case reflect.Struct:
+		return marshalStruct(v)
+	}
+	return nil, fmt.Errorf("bencode: cannot marshal %s", v.Type())
+}
+
+func marshalRawString(s string) []byte {
+	return []byte(fmt.Sprintf("%d:%s", len(s), s))
+}
+
+// MarshalRawBytes encodes b as a bencode byte-string. It's exported for
+// types like util.CompactPeers that implement Marshaler themselves: their
+// natural representation is already a packed byte slice, and it should be
+// framed the same way marshalValue frames any other []byte.
+func MarshalRawBytes(b []byte) []byte {
+	return append([]byte(fmt.Sprintf("%d:", len(b))), b...)
+}
+
+func marshalRawBytes(b []byte) []byte {
+	return MarshalRawBytes(b)
+}
+
+type fieldValue struct {
+	key   string
+	value []byte
+}
+
+func marshalStruct(v reflect.Value) ([]byte, error) {
+	t := v.Type()
+	fields := make([]fieldValue, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		if isEmptyValue(fv) {
+			continue
+		}
+		b, err := marshalValue(fv)
+		if err != nil {
+			return nil, err
+		}
+		name := f.Name
+		if tag := f.Tag.Get("bencode"); tag != "" {
+			name = tag
+		}
+		fields = append(fields, fieldValue{name, b})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+	out := []byte{'d'}
+	for _, fv := range fields {
+		out = append(out, marshalRawString(fv.key)...)
+		out = append(out, fv.value...)
+	}
+	return append(out, 'e'), nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Unmarshal parses the bencoded data in b into v, which must be a
+// pointer.
+func Unmarshal(b []byte, v interface{}) error {
+	return NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+// Decoder reads a single bencoded value at a time from an input stream.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{bufio.NewReader(r)}
+}
+
+// Decode parses the next bencoded value from the stream into v, which
+// must be a non-nil pointer.
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("bencode: Decode requires a non-nil pointer")
+	}
+	return d.parseInto(rv.Elem())
+}
+
+func (d *Decoder) parseInto(v reflect.Value) error {
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return err
+	}
+	switch {
+	case b[0] == 'd':
+		return d.parseDict(v)
+	case b[0] == 'l':
+		return d.parseList(v)
+	case b[0] == 'i':
+		return d.parseInt(v)
+	default:
+		return d.parseString(v)
+	}
+}
+
+func (d *Decoder) readRawString() ([]byte, error) {
+	lenStr, err := d.r.ReadString(':')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(lenStr[:len(lenStr)-1])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("bencode: bad string length %q", lenStr)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (d *Decoder) parseString(v reflect.Value) error {
+	raw, err := d.readRawString()
+	if err != nil {
+		return err
+	}
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(Unmarshaler); ok {
+			return u.UnmarshalBencode(raw)
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(raw))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(raw)
+			return nil
+		}
+		return fmt.Errorf("bencode: cannot unmarshal string into %s", v.Type())
+	default:
+		return fmt.Errorf("bencode: cannot unmarshal string into %s", v.Type())
+	}
+	return nil
+}
+
+func (d *Decoder) parseInt(v reflect.Value) error {
+	if _, err := d.r.ReadByte(); err != nil { // 'i'
+		return err
+	}
+	s, err := d.r.ReadString('e')
+	if err != nil {
+		return err
+	}
+	s = s[:len(s)-1]
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bencode: bad integer %q: %s", s, err)
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(n))
+	default:
+		return fmt.Errorf("bencode: cannot unmarshal integer into %s", v.Type())
+	}
+	return nil
+}
+
+func (d *Decoder) parseList(v reflect.Value) error {
+	if _, err := d.r.ReadByte(); err != nil { // 'l'
+		return err
+	}
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("bencode: cannot unmarshal list into %s", v.Type())
+	}
+	for {
+		b, err := d.r.Peek(1)
+		if err != nil {
+			return err
+		}
+		if b[0] == 'e' {
+			d.r.ReadByte()
+			return nil
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := d.parseInto(elem); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem))
+	}
+}
+
+func (d *Decoder) parseDict(v reflect.Value) error {
+	if _, err := d.r.ReadByte(); err != nil { // 'd'
+		return err
+	}
+	for {
+		b, err := d.r.Peek(1)
+		if err != nil {
+			return err
+		}
+		if b[0] == 'e' {
+			d.r.ReadByte()
+			return nil
+		}
+		key, err := d.readRawString()
+		if err != nil {
+			return err
+		}
+		field := fieldByTag(v, string(key))
+		if !field.IsValid() {
+			if err := d.skipValue(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.parseInto(field); err != nil {
+			return err
+		}
+	}
+}
+
+// fieldByTag finds the struct field of v tagged with the given bencode
+// key, falling back to an exact field name match.
+func fieldByTag(v reflect.Value, key string) reflect.Value {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("bencode") == key || f.Name == key {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// skipValue discards the next bencoded value without decoding it into
+// anything, for dict keys the destination struct doesn't have a field
+// for.
+func (d *Decoder) skipValue() error {
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return err
+	}
+	switch {
+	case b[0] == 'd':
+		d.r.ReadByte()
+		for {
+			b, err := d.r.Peek(1)
+			if err != nil {
+				return err
+			}
+			if b[0] == 'e' {
+				d.r.ReadByte()
+				return nil
+			}
+			if _, err := d.readRawString(); err != nil {
+				return err
+			}
+			if err := d.skipValue(); err != nil {
+				return err
+			}
+		}
+	case b[0] == 'l':
+		d.r.ReadByte()
+		for {
+			b, err := d.r.Peek(1)
+			if err != nil {
+				return err
+			}
+			if b[0] == 'e' {
+				d.r.ReadByte()
+				return nil
+			}
+			if err := d.skipValue(); err != nil {
+				return err
+			}
+		}
+	case b[0] == 'i':
+		_, err := d.r.ReadString('e')
+		return err
+	default:
+		_, err := d.readRawString()
+		return err
+	}
+}
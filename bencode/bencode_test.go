@@ -0,0 +1,45 @@
+package bencode
+
+import "testing"
+
+func TestMarshalString(t *testing.T) {
+	b, err := Marshal("spam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "4:spam" {
+		t.Fatalf("got %q", b)
+	}
+}
+
+func TestRoundTripStruct(t *testing.T) {
+	type thing struct {
+		Name string `bencode:"name"`
+		Size int64  `bencode:"size"`
+	}
+	in := thing{"greeting.txt", 13}
+	b, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out thing
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestUnmarshalIgnoresUnknownKeys(t *testing.T) {
+	type thing struct {
+		Name string `bencode:"name"`
+	}
+	var out thing
+	if err := Unmarshal([]byte("d4:junki1e4:name4:spame"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "spam" {
+		t.Fatalf("got %+v", out)
+	}
+}
@@ -0,0 +1,92 @@
+package torrent
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// DefaultBanThreshold is the number of failures attributable to a single
+// peer IP -- bad piece data, invalid protocol messages, or a failed MSE
+// handshake -- before it's automatically banned.
+const DefaultBanThreshold = 5
+
+// ClientConfig holds the tunables for a Client. The zero value is usable
+// and gives reasonable defaults.
+type ClientConfig struct {
+	// BanThreshold overrides DefaultBanThreshold if non-zero.
+	BanThreshold int
+}
+
+// Client is shared by every torrent the engine manages. It currently holds
+// state that has to be consistent across all of them: which peer IPs have
+// been banned, and how many failures each peer IP has been charged with.
+type Client struct {
+	config ClientConfig
+
+	mu          sync.Mutex
+	badPeerIPs  map[string]int
+	bannedPeers map[string]net.IP
+}
+
+// NewClient returns a Client configured per config.
+func NewClient(config ClientConfig) *Client {
+	if config.BanThreshold == 0 {
+		config.BanThreshold = DefaultBanThreshold
+	}
+	return &Client{
+		config:      config,
+		badPeerIPs:  make(map[string]int),
+		bannedPeers: make(map[string]net.IP),
+	}
+}
+
+// BanPeerIP immediately bans ip, regardless of its failure count.
+func (cl *Client) BanPeerIP(ip net.IP) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.bannedPeers[ip.String()] = ip
+}
+
+// BannedPeers returns every IP currently banned.
+func (cl *Client) BannedPeers() []net.IP {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	ips := make([]net.IP, 0, len(cl.bannedPeers))
+	for _, ip := range cl.bannedPeers {
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// IsBannedPeerIP reports whether ip is banned. Trackers, the DHT, and PEX
+// must all filter candidate peers through this before they're added to a
+// torrent's peer pool, and connection acceptance/dialing must check it
+// before completing a handshake.
+func (cl *Client) IsBannedPeerIP(ip net.IP) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	_, ok := cl.bannedPeers[ip.String()]
+	return ok
+}
+
+// RecordBadPeer credits ip with a failure and bans it once it crosses
+// cl.config.BanThreshold.
+func (cl *Client) RecordBadPeer(ip net.IP) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	key := ip.String()
+	cl.badPeerIPs[key]++
+	if cl.badPeerIPs[key] >= cl.config.BanThreshold {
+		cl.bannedPeers[key] = ip
+	}
+}
+
+// WriteStatus writes a human-readable summary of the client's banning
+// state, for inclusion on a status page.
+func (cl *Client) WriteStatus(w io.Writer) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	fmt.Fprintf(w, "Banned peers: %d\n", len(cl.bannedPeers))
+}
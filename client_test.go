@@ -0,0 +1,36 @@
+package torrent
+
+import (
+	"net"
+	"testing"
+)
+
+func TestBanPeerIP(t *testing.T) {
+	cl := NewClient(ClientConfig{})
+	ip := net.ParseIP("1.2.3.4")
+	if cl.IsBannedPeerIP(ip) {
+		t.Fatal("shouldn't start out banned")
+	}
+	cl.BanPeerIP(ip)
+	if !cl.IsBannedPeerIP(ip) {
+		t.Fatal("should be banned")
+	}
+	if len(cl.BannedPeers()) != 1 {
+		t.Fatal("expected one banned peer")
+	}
+}
+
+func TestRecordBadPeerThreshold(t *testing.T) {
+	cl := NewClient(ClientConfig{BanThreshold: 3})
+	ip := net.ParseIP("5.6.7.8")
+	for i := 0; i < 2; i++ {
+		cl.RecordBadPeer(ip)
+		if cl.IsBannedPeerIP(ip) {
+			t.Fatal("shouldn't be banned before crossing the threshold")
+		}
+	}
+	cl.RecordBadPeer(ip)
+	if !cl.IsBannedPeerIP(ip) {
+		t.Fatal("should be banned after crossing the threshold")
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"bitbucket.org/anacrolix/go.torrent/peer_protocol"
 	metainfo "github.com/nsf/libtorgo/torrent"
 	"launchpad.net/gommap"
+
+	"github.com/anacrolix/torrent/storage"
 )
 
 const (
@@ -44,12 +46,72 @@ type piece struct {
 	Hashing           bool
 	QueuedForHash     bool
 	EverHashed        bool
+
+	// Storage is this piece's backing store, opened from the torrent's
+	// storage.Torrent. It's the source of truth for completion and the
+	// only way the piece's data is read or written; it's nil until the
+	// piece has been assigned one.
+	Storage storage.Piece
 }
 
+// Complete reports whether the piece is fully downloaded. Once Storage is
+// set, its completion record is authoritative; PendingChunkSpecs/EverHashed
+// are only consulted before that, while the piece is still being assembled
+// and has nothing backing it yet.
 func (p *piece) Complete() bool {
+	if p.Storage != nil {
+		return p.Storage.GetIsComplete()
+	}
 	return len(p.PendingChunkSpecs) == 0 && p.EverHashed
 }
 
+// MarkComplete records p as fully downloaded and hash-checked, both in
+// Storage and in the chunk-tracking fields used before Storage existed. The
+// chunk-tracking fields are only updated once Storage (if any) confirms the
+// completion, so a failed write doesn't leave them out of sync with it.
+func (p *piece) MarkComplete() error {
+	if p.Storage != nil {
+		if err := p.Storage.MarkComplete(); err != nil {
+			return err
+		}
+	}
+	p.EverHashed = true
+	p.PendingChunkSpecs = nil
+	return nil
+}
+
+// MarkNotComplete discards p's completion record, for example after a
+// later hash check fails.
+func (p *piece) MarkNotComplete() error {
+	if p.Storage != nil {
+		if err := p.Storage.MarkNotComplete(); err != nil {
+			return err
+		}
+	}
+	p.EverHashed = false
+	return nil
+}
+
+// ReadAt reads p's data from Storage, at an offset relative to the start
+// of the piece. It returns ErrDataNotReady if Storage hasn't been
+// assigned yet.
+func (p *piece) ReadAt(b []byte, off int64) (int, error) {
+	if p.Storage == nil {
+		return 0, ErrDataNotReady
+	}
+	return p.Storage.ReadAt(b, off)
+}
+
+// WriteAt writes to p's data in Storage, at an offset relative to the
+// start of the piece. It returns ErrDataNotReady if Storage hasn't been
+// assigned yet.
+func (p *piece) WriteAt(b []byte, off int64) (int, error) {
+	if p.Storage == nil {
+		return 0, ErrDataNotReady
+	}
+	return p.Storage.WriteAt(b, off)
+}
+
 func lastChunkSpec(pieceLength peer_protocol.Integer) (cs chunkSpec) {
 	cs.Begin = (pieceLength - 1) / chunkSize * chunkSize
 	cs.Length = pieceLength - cs.Begin
@@ -90,6 +152,11 @@ var (
 	ErrDataNotReady = errors.New("data not ready")
 )
 
+// mmapTorrentData mmaps every file of metaInfo under location and returns
+// the result as a single mmap_span.MMapSpan. It predates the storage
+// package and isn't called by storage.NewMMap, which implements the same
+// mmapping independently behind the storage.Client/Torrent/Piece
+// interfaces that piece.Storage now uses.
 func mmapTorrentData(metaInfo *metainfo.MetaInfo, location string) (mms mmap_span.MMapSpan, err error) {
 	defer func() {
 		if err != nil {
@@ -136,4 +203,4 @@ func mmapTorrentData(metaInfo *metainfo.MetaInfo, location string) (mms mmap_spa
 		}
 	}
 	return
-}
\ No newline at end of file
+}
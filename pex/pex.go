@@ -0,0 +1,189 @@
+// Package pex implements the ut_pex extended message (BEP 11), letting
+// peers that already share a torrent tell each other about further peers
+// without going through a tracker or the DHT.
+package pex
+
+import (
+	"net"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/util"
+)
+
+// ExtendedName is the name used to negotiate ut_pex in the BEP 10 extended
+// handshake's "m" dictionary.
+const ExtendedName = "ut_pex"
+
+// Per-peer flag bits set in the "added.f"/"added6.f" byte strings.
+const (
+	FlagPrefersEncryption byte = 1 << 0
+	FlagSeed              byte = 1 << 1
+	FlagSupportsUtp       byte = 1 << 2
+	FlagSupportsHolepunch byte = 1 << 3
+)
+
+// MinSendInterval is how often a Conn will bother sending another PEX
+// message to its peer, per BEP 11's recommendation.
+const MinSendInterval = time.Minute
+
+// MaxAddrsPerMessage caps how many added/dropped peers are sent in a
+// single message, to keep individual PEX messages small.
+const MaxAddrsPerMessage = 50
+
+// Message is the bencoded body of a ut_pex extended message.
+type Message struct {
+	Added       util.CompactPeers     `bencode:"added"`
+	AddedFlags  []byte                `bencode:"added.f"`
+	Dropped     util.CompactPeers     `bencode:"dropped"`
+	Added6      util.CompactIPv6Peers `bencode:"added6"`
+	Added6Flags []byte                `bencode:"added6.f"`
+	Dropped6    util.CompactIPv6Peers `bencode:"dropped6"`
+}
+
+// Peer is a peer discovered via PEX, with the flags its advertiser sent
+// for it.
+type Peer struct {
+	Addr  *net.TCPAddr
+	Flags byte
+}
+
+// Conn tracks ut_pex state for a single peer connection: the peers we've
+// already told them about, so we only ever send deltas, and the last time
+// we sent them anything, so we don't send more often than MinSendInterval.
+type Conn struct {
+	sent     map[string]struct{}
+	lastSent time.Time
+}
+
+// NewConn returns a Conn ready to track PEX state for a freshly
+// handshaken peer.
+func NewConn() *Conn {
+	return &Conn{sent: make(map[string]struct{})}
+}
+
+// Outgoing holds the peers known to the torrent that a Conn hasn't yet
+// told its peer about, and the ones that have disappeared since.
+type Outgoing struct {
+	Added   []Peer
+	Dropped []Peer
+}
+
+// Share builds the next Message to send, if MinSendInterval has elapsed
+// and there's anything new to say. It returns ok == false when there's
+// nothing to send right now.
+func (c *Conn) Share(out Outgoing, now time.Time) (m Message, ok bool) {
+	if !c.lastSent.IsZero() && now.Sub(c.lastSent) < MinSendInterval {
+		return
+	}
+	added := dedupeNew(c.sent, out.Added, true)
+	dropped := dedupeNew(c.sent, out.Dropped, false)
+	if len(added) == 0 && len(dropped) == 0 {
+		return
+	}
+	if len(added) > MaxAddrsPerMessage {
+		added = added[:MaxAddrsPerMessage]
+	}
+	if len(dropped) > MaxAddrsPerMessage {
+		dropped = dropped[:MaxAddrsPerMessage]
+	}
+	// Only mark added peers as sent once we know they're actually going
+	// into m: dedupeNew doesn't record them itself, since it runs before
+	// the MaxAddrsPerMessage truncation above, and a peer that gets
+	// truncated away here must still look new next time Share is called.
+	for _, p := range added {
+		appendPeer(&m, p, true)
+		c.sent[p.Addr.String()] = struct{}{}
+	}
+	for _, p := range dropped {
+		appendPeer(&m, p, false)
+		delete(c.sent, p.Addr.String())
+	}
+	c.lastSent = now
+	ok = true
+	return
+}
+
+// dedupeNew filters peers against the sent set: when record is true (an
+// addition), it keeps the ones not already marked sent; when record is
+// false (a drop), it keeps only the ones that were, since there's nothing
+// to tell the peer about dropping something we never announced. It does
+// not itself mutate sent; the caller records that once it knows which of
+// the peers returned here actually end up in the outgoing message.
+func dedupeNew(sent map[string]struct{}, peers []Peer, record bool) []Peer {
+	out := make([]Peer, 0, len(peers))
+	for _, p := range peers {
+		_, already := sent[p.Addr.String()]
+		if record == already {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func appendPeer(m *Message, p Peer, added bool) {
+	ip4 := p.Addr.IP.To4()
+	if ip4 != nil {
+		var cp util.CompactPeer
+		copy(cp.IP[:], ip4)
+		cp.Port = p.Addr.Port
+		if added {
+			m.Added = append(m.Added, cp)
+			m.AddedFlags = append(m.AddedFlags, p.Flags)
+		} else {
+			m.Dropped = append(m.Dropped, cp)
+		}
+		return
+	}
+	var cp util.CompactIPv6Peer
+	copy(cp.IP[:], p.Addr.IP.To16())
+	cp.Port = p.Addr.Port
+	if added {
+		m.Added6 = append(m.Added6, cp)
+		m.Added6Flags = append(m.Added6Flags, p.Flags)
+	} else {
+		m.Dropped6 = append(m.Dropped6, cp)
+	}
+}
+
+// Recv decodes a received ut_pex payload into the peers it names, so the
+// caller can feed them into its peer pool after filtering against
+// already-connected and banned addresses.
+func Recv(payload []byte) (added []Peer, dropped []Peer, err error) {
+	var m Message
+	if err = bencode.Unmarshal(payload, &m); err != nil {
+		return
+	}
+	added = appendFlagged(added, m.Added, m.AddedFlags, false)
+	added = appendFlagged(added, m.Added6, m.Added6Flags, true)
+	dropped = appendUnflagged(dropped, m.Dropped, false)
+	dropped = appendUnflagged(dropped, m.Dropped6, true)
+	return
+}
+
+func appendFlagged(dst []Peer, peers interface{}, flags []byte, v6 bool) []Peer {
+	switch ps := peers.(type) {
+	case util.CompactPeers:
+		for i, p := range ps {
+			dst = append(dst, Peer{&net.TCPAddr{IP: net.IP(p.IP[:]), Port: p.Port}, flagAt(flags, i)})
+		}
+	case util.CompactIPv6Peers:
+		for i, p := range ps {
+			dst = append(dst, Peer{&net.TCPAddr{IP: net.IP(p.IP[:]), Port: p.Port}, flagAt(flags, i)})
+		}
+	}
+	_ = v6
+	return dst
+}
+
+func appendUnflagged(dst []Peer, peers interface{}, v6 bool) []Peer {
+	return appendFlagged(dst, peers, nil, v6)
+}
+
+func flagAt(flags []byte, i int) byte {
+	if i >= len(flags) {
+		return 0
+	}
+	return flags[i]
+}
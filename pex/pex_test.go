@@ -0,0 +1,70 @@
+package pex
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestShareThenRecv(t *testing.T) {
+	c := NewConn()
+	out := Outgoing{Added: []Peer{{&net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 5}, FlagSeed}}}
+	now := time.Unix(0, 0)
+
+	m, ok := c.Share(out, now)
+	if !ok {
+		t.Fatal("expected a message")
+	}
+	if len(m.Added) != 1 || m.Added[0].Port != 5 {
+		t.Fatalf("unexpected added list: %+v", m.Added)
+	}
+
+	if _, ok := c.Share(out, now.Add(time.Second)); ok {
+		t.Fatal("should not resend the same peer before MinSendInterval, let alone at all")
+	}
+
+	payload, err := bencode.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, dropped, err := Recv(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || len(dropped) != 0 {
+		t.Fatalf("got added=%v dropped=%v", added, dropped)
+	}
+	if added[0].Addr.Port != 5 || added[0].Flags != FlagSeed {
+		t.Fatalf("unexpected peer: %+v", added[0])
+	}
+}
+
+// Peers beyond MaxAddrsPerMessage must not be marked sent, or they would
+// never be offered to this peer on any later call either.
+func TestShareTruncatesWithoutLosingOverflow(t *testing.T) {
+	c := NewConn()
+	var peers []Peer
+	for i := 0; i < MaxAddrsPerMessage+10; i++ {
+		peers = append(peers, Peer{&net.TCPAddr{IP: net.IPv4(1, 2, byte(i>>8), byte(i)), Port: i + 1}, 0})
+	}
+	out := Outgoing{Added: peers}
+	now := time.Unix(0, 0)
+
+	m, ok := c.Share(out, now)
+	if !ok {
+		t.Fatal("expected a message")
+	}
+	if len(m.Added) != MaxAddrsPerMessage {
+		t.Fatalf("expected exactly %d peers, got %d", MaxAddrsPerMessage, len(m.Added))
+	}
+
+	m2, ok := c.Share(out, now.Add(MinSendInterval))
+	if !ok {
+		t.Fatal("expected a follow-up message carrying the overflow peers")
+	}
+	if len(m2.Added) != 10 {
+		t.Fatalf("expected the 10 peers left over from the first message, got %d", len(m2.Added))
+	}
+}
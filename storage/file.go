@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+
+	metainfo "github.com/nsf/libtorgo/torrent"
+)
+
+// NewFile returns a Client that stores each torrent's files directly on
+// disk beneath location, using positional reads and writes instead of
+// mmap. It suits workloads where mmap's page-fault-driven IO or its
+// per-file virtual memory mapping is undesirable, such as very large
+// torrents or systems under memory pressure.
+func NewFile(location string) Client {
+	return NewFileWithCompletion(location, NewMapPieceCompletion())
+}
+
+// NewFileWithCompletion is like NewFile, but stores completion state in
+// completion instead of an in-memory map, so that it can persist across
+// restarts or be shared with other storage.Clients (for example a
+// PieceCompletion returned by NewSqlitePieceCompletion).
+func NewFileWithCompletion(location string, completion PieceCompletion) Client {
+	return &fileClient{location, completion}
+}
+
+type fileClient struct {
+	location   string
+	completion PieceCompletion
+}
+
+func (me *fileClient) OpenTorrent(info *metainfo.MetaInfo, infoHash [20]byte) (Torrent, error) {
+	files := make([]fileEntry, 0, len(info.Files))
+	var offset int64
+	for _, mif := range info.Files {
+		fileName := filepath.Join(append([]string{me.location, info.Name}, mif.Path...)...)
+		if err := os.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0666)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, fileEntry{f, offset, mif.Length})
+		offset += mif.Length
+	}
+	return &fileTorrent{infoHash, files, me.completion, info.PieceLength}, nil
+}
+
+type fileEntry struct {
+	f      *os.File
+	offset int64
+	length int64
+}
+
+type fileTorrent struct {
+	infoHash    [20]byte
+	files       []fileEntry
+	completion  PieceCompletion
+	pieceLength int64
+}
+
+func (me *fileTorrent) Piece(index int, length int64) Piece {
+	return &filePiece{me, int64(index) * me.pieceLength, length, PieceCompletionKey{me.infoHash, index}}
+}
+
+func (me *fileTorrent) Close() error {
+	var err error
+	for _, fe := range me.files {
+		if e := fe.f.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// filePiece implements Piece by fanning reads and writes out across the
+// underlying files that the piece spans, the same way mmapTorrentData fans
+// an mmap region out across files.
+type filePiece struct {
+	t      *fileTorrent
+	off    int64
+	length int64
+	key    PieceCompletionKey
+}
+
+func (me *filePiece) eachFile(off int64, b []byte, fn func(*os.File, int64, []byte) (int, error)) (n int, err error) {
+	off += me.off
+	for _, fe := range me.t.files {
+		if off < fe.offset || off >= fe.offset+fe.length {
+			continue
+		}
+		avail := fe.offset + fe.length - off
+		chunk := b
+		if int64(len(chunk)) > avail {
+			chunk = chunk[:avail]
+		}
+		nn, e := fn(fe.f, off-fe.offset, chunk)
+		n += nn
+		off += int64(nn)
+		b = b[nn:]
+		if e != nil {
+			return n, e
+		}
+		if len(b) == 0 {
+			return n, nil
+		}
+	}
+	return n, nil
+}
+
+func (me *filePiece) ReadAt(b []byte, off int64) (int, error) {
+	return me.eachFile(off, b, func(f *os.File, off int64, b []byte) (int, error) {
+		return f.ReadAt(b, off)
+	})
+}
+
+func (me *filePiece) WriteAt(b []byte, off int64) (int, error) {
+	return me.eachFile(off, b, func(f *os.File, off int64, b []byte) (int, error) {
+		return f.WriteAt(b, off)
+	})
+}
+
+func (me *filePiece) MarkComplete() error {
+	return me.t.completion.Set(me.key, true)
+}
+
+func (me *filePiece) MarkNotComplete() error {
+	return me.t.completion.Set(me.key, false)
+}
+
+func (me *filePiece) GetIsComplete() bool {
+	c, _ := me.t.completion.Get(me.key)
+	return c
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	metainfo "github.com/nsf/libtorgo/torrent"
+)
+
+func TestFileClientReadWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage-file-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	info := &metainfo.MetaInfo{
+		Name: "greeting",
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a.txt"}, Length: 5},
+			{Path: []string{"b.txt"}, Length: 5},
+		},
+	}
+	var infoHash [20]byte
+
+	tor, err := NewFile(dir).OpenTorrent(info, infoHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tor.Close()
+
+	p := tor.Piece(0, 10)
+	if p.GetIsComplete() {
+		t.Fatal("fresh piece should not be complete")
+	}
+	if _, err := p.WriteAt([]byte("helloworld"), 0); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if _, err := p.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "helloworld" {
+		t.Fatalf("got %q", buf)
+	}
+	if err := p.MarkComplete(); err != nil {
+		t.Fatal(err)
+	}
+	if !p.GetIsComplete() {
+		t.Fatal("piece should be complete after MarkComplete")
+	}
+}
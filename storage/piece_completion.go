@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// PieceCompletion records which pieces of which torrents are complete,
+// independently of how the piece data itself is stored. This lets a single
+// completion database (for example Bolt or SQLite backed) be shared across
+// different Piece backends.
+type PieceCompletion interface {
+	Get(key PieceCompletionKey) (complete bool, err error)
+	Set(key PieceCompletionKey, complete bool) error
+	Close() error
+}
+
+// PieceCompletionKey identifies a single piece of a single torrent.
+type PieceCompletionKey struct {
+	InfoHash [20]byte
+	Index    int
+}
+
+// NewMapPieceCompletion returns a PieceCompletion backed by an in-memory
+// map. Nothing is persisted across process restarts. It's what NewFile and
+// NewMMap use by default, so with those, completion recorded before a
+// restart is lost.
+func NewMapPieceCompletion() PieceCompletion {
+	return &mapPieceCompletion{m: make(map[PieceCompletionKey]bool)}
+}
+
+type mapPieceCompletion struct {
+	mu sync.Mutex
+	m  map[PieceCompletionKey]bool
+}
+
+func (me *mapPieceCompletion) Get(k PieceCompletionKey) (bool, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.m[k], nil
+}
+
+func (me *mapPieceCompletion) Set(k PieceCompletionKey, complete bool) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.m[k] = complete
+	return nil
+}
+
+func (me *mapPieceCompletion) Close() error {
+	return nil
+}
+
+// NewSqlitePieceCompletion returns a PieceCompletion backed by a SQLite
+// database file at path. Unlike NewMapPieceCompletion, completion state
+// survives process restarts, and the returned PieceCompletion can be handed
+// to a storage.Client for an unrelated piece-data backend (for example
+// NewFileWithCompletion or NewMMapWithCompletion) so the completion
+// records don't have to live alongside the piece data itself.
+func NewSqlitePieceCompletion(path string) (PieceCompletion, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := newSqlitePieceCompletion(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return pc, nil
+}
+
+func newSqlitePieceCompletion(db *sql.DB) (*sqlitePieceCompletion, error) {
+	if _, err := db.Exec(`create table if not exists piece_completion (info_hash blob, idx integer, complete integer, primary key (info_hash, idx))`); err != nil {
+		return nil, fmt.Errorf("creating schema: %s", err)
+	}
+	return &sqlitePieceCompletion{db}, nil
+}
+
+type sqlitePieceCompletion struct {
+	db *sql.DB
+}
+
+func (me *sqlitePieceCompletion) Get(k PieceCompletionKey) (complete bool, err error) {
+	row := me.db.QueryRow(`select complete from piece_completion where info_hash = ? and idx = ?`, k.InfoHash[:], k.Index)
+	err = row.Scan(&complete)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
+func (me *sqlitePieceCompletion) Set(k PieceCompletionKey, complete bool) error {
+	_, err := me.db.Exec(`insert or replace into piece_completion (info_hash, idx, complete) values (?, ?, ?)`, k.InfoHash[:], k.Index, complete)
+	return err
+}
+
+func (me *sqlitePieceCompletion) Close() error {
+	return me.db.Close()
+}
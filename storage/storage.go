@@ -0,0 +1,45 @@
+// Package storage abstracts over where and how torrent piece data is kept,
+// so the engine doesn't have to care whether it's mmapped files, plain file
+// IO, or something entirely self-contained like a SQLite database.
+package storage
+
+import (
+	"io"
+
+	metainfo "github.com/nsf/libtorgo/torrent"
+)
+
+// Client is the top-level handle a torrent engine opens once per backend.
+// It's responsible for turning a torrent's metainfo into something that
+// can serve reads and writes for that torrent's pieces.
+type Client interface {
+	OpenTorrent(info *metainfo.MetaInfo, infoHash [20]byte) (Torrent, error)
+}
+
+// Torrent provides access to the pieces of a single torrent opened from a
+// Client. Implementations are free to lazily create backing storage the
+// first time a given piece is touched.
+type Torrent interface {
+	// Piece returns the storage for the piece at the given index. length
+	// is the number of bytes in that piece (the last piece of a torrent
+	// is usually shorter than info.PieceLength).
+	Piece(index int, length int64) Piece
+	Close() error
+}
+
+// Piece is the data and completion state for a single torrent piece.
+// Offsets passed to ReadAt/WriteAt are relative to the start of the piece,
+// not the torrent.
+type Piece interface {
+	io.ReaderAt
+	io.WriterAt
+
+	// MarkComplete records that the piece has been fully downloaded and
+	// passed its hash check.
+	MarkComplete() error
+	// MarkNotComplete discards any completion record for the piece, for
+	// example after a later hash check fails.
+	MarkNotComplete() error
+	// GetIsComplete reports the last state recorded by Mark(Not)Complete.
+	GetIsComplete() bool
+}
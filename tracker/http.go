@@ -0,0 +1,89 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/util"
+)
+
+// httpClient implements Client against the classic HTTP/HTTPS tracker
+// protocol: a GET request with query parameters, replying with a bencoded
+// dictionary.
+type httpClient struct {
+	url *url.URL
+}
+
+func newHTTPClient(u *url.URL) *httpClient {
+	return &httpClient{u}
+}
+
+func (me *httpClient) Announce(ctx context.Context, ar AnnounceRequest) (AnnounceResponse, error) {
+	u := *me.url
+	q := u.Query()
+	q.Set("info_hash", string(ar.InfoHash[:]))
+	q.Set("peer_id", string(ar.PeerId[:]))
+	q.Set("port", strconv.FormatUint(uint64(ar.Port), 10))
+	q.Set("uploaded", strconv.FormatInt(ar.Uploaded, 10))
+	q.Set("downloaded", strconv.FormatInt(ar.Downloaded, 10))
+	q.Set("left", strconv.FormatInt(ar.Left, 10))
+	q.Set("compact", "1")
+	q.Set("numwant", strconv.FormatInt(int64(ar.NumWant), 10))
+	if ar.Event != None {
+		q.Set("event", []string{"", "completed", "started", "stopped"}[ar.Event])
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return AnnounceResponse{}, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return AnnounceResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return AnnounceResponse{}, fmt.Errorf("tracker gave http response status %q", resp.Status)
+	}
+	var body struct {
+		FailureReason string `bencode:"failure reason"`
+		Interval      int32  `bencode:"interval"`
+		MinInterval   int32  `bencode:"min interval"`
+		Leechers      int32  `bencode:"incomplete"`
+		Seeders       int32  `bencode:"complete"`
+		Peers         string `bencode:"peers"`
+	}
+	if err := bencode.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return AnnounceResponse{}, err
+	}
+	if body.FailureReason != "" {
+		return AnnounceResponse{}, fmt.Errorf("tracker gave failure reason: %q", body.FailureReason)
+	}
+	peers, err := util.UnmarshalCompactPeers([]byte(body.Peers))
+	if err != nil {
+		return AnnounceResponse{}, err
+	}
+	interval := body.Interval
+	if body.MinInterval > interval {
+		interval = body.MinInterval
+	}
+	return AnnounceResponse{
+		Interval: interval,
+		Leechers: body.Leechers,
+		Seeders:  body.Seeders,
+		Peers:    peers,
+	}, nil
+}
+
+func (me *httpClient) Scrape(ctx context.Context, infoHashes [][20]byte) (ScrapeResponse, error) {
+	return ScrapeResponse{}, fmt.Errorf("scrape not implemented for http trackers")
+}
+
+func (me *httpClient) Close() error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package tracker
+
+import (
+	"fmt"
+	"sync"
+)
+
+// NewMemoryPeerStore returns a PeerStore that keeps all swarm state in
+// memory. It's the default store for Server, and is lost on restart.
+func NewMemoryPeerStore() PeerStore {
+	return &memoryPeerStore{swarms: make(map[[20]byte]map[string]Peer)}
+}
+
+type memoryPeerStore struct {
+	mu     sync.Mutex
+	swarms map[[20]byte]map[string]Peer
+}
+
+func (me *memoryPeerStore) peerKey(p Peer) string {
+	return fmt.Sprintf("%s:%d", p.IP, p.Port)
+}
+
+func (me *memoryPeerStore) AddPeer(infoHash [20]byte, peer Peer) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	swarm, ok := me.swarms[infoHash]
+	if !ok {
+		swarm = make(map[string]Peer)
+		me.swarms[infoHash] = swarm
+	}
+	swarm[me.peerKey(peer)] = peer
+	return nil
+}
+
+func (me *memoryPeerStore) DropPeer(infoHash [20]byte, peer Peer) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	delete(me.swarms[infoHash], me.peerKey(peer))
+	return nil
+}
+
+func (me *memoryPeerStore) Peers(infoHash [20]byte, numWant int, exclude Peer) ([]Peer, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	excludeKey := me.peerKey(exclude)
+	peers := make([]Peer, 0, numWant)
+	for key, p := range me.swarms[infoHash] {
+		if len(peers) >= numWant {
+			break
+		}
+		if key == excludeKey {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+func (me *memoryPeerStore) CountPeers(infoHash [20]byte) (seeders, leechers int32, err error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, p := range me.swarms[infoHash] {
+		if p.Left == 0 {
+			seeders++
+		} else {
+			leechers++
+		}
+	}
+	return
+}
@@ -0,0 +1,234 @@
+package tracker
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	"github.com/anacrolix/torrent/util"
+)
+
+// connTTL is how long a connection ID issued by Server stays valid for the
+// address it was issued to. Connection IDs are actually accepted for
+// between connTTL and 2*connTTL, since checkConnId accepts both the
+// current and the previous time window (see connIdForWindow).
+const connTTL = 2 * time.Minute
+
+// Peer is what a Server's PeerStore remembers about one peer in one
+// torrent's swarm.
+type Peer struct {
+	IP   net.IP
+	Port uint16
+	Left int64
+}
+
+// PeerStore is the swarm-state backend a Server uses to record and return
+// peers. The default is an in-memory store (NewMemoryPeerStore); it's an
+// interface so a Server can instead be backed by an external DB shared
+// with other tracker processes.
+type PeerStore interface {
+	AddPeer(infoHash [20]byte, peer Peer) error
+	DropPeer(infoHash [20]byte, peer Peer) error
+	// Peers returns up to numWant peers for infoHash, never including
+	// exclude itself.
+	Peers(infoHash [20]byte, numWant int, exclude Peer) ([]Peer, error)
+	CountPeers(infoHash [20]byte) (seeders, leechers int32, err error)
+}
+
+// Server is the server side of BEP 15: it answers Connect, Announce, and
+// Scrape requests over UDP, making this module usable to run a private
+// tracker, or as a fixture for tests that would otherwise depend on public
+// trackers.
+type Server struct {
+	conn  net.PacketConn
+	store PeerStore
+
+	// Authorize, if set, is consulted on every announce; returning an
+	// error rejects the peer instead of recording or returning it.
+	Authorize func(infoHash [20]byte, peer Peer) error
+
+	// secret keys the HMAC that ties a connection ID to the address it was
+	// issued to, so Server doesn't need to remember one per address: a
+	// connection ID is valid if and only if it's what checkConnId would
+	// generate again for the same address and time window.
+	secret [32]byte
+}
+
+// NewServer returns a Server that answers requests received on conn,
+// storing swarm state in store, or in a NewMemoryPeerStore if store is nil.
+func NewServer(conn net.PacketConn, store PeerStore) *Server {
+	if store == nil {
+		store = NewMemoryPeerStore()
+	}
+	s := &Server{conn: conn, store: store}
+	if _, err := io.ReadFull(rand.Reader, s.secret[:]); err != nil {
+		// The system's CSPRNG is unavailable; there's nothing sensible to
+		// do except fail loudly.
+		panic(err)
+	}
+	return s
+}
+
+// Serve reads and answers requests until conn is closed or returns an
+// error.
+func (s *Server) Serve() error {
+	b := make([]byte, 0x800)
+	for {
+		n, addr, err := s.conn.ReadFrom(b)
+		if err != nil {
+			return err
+		}
+		payload := make([]byte, n)
+		copy(payload, b[:n])
+		go s.handle(addr, payload)
+	}
+}
+
+func (s *Server) handle(addr net.Addr, b []byte) {
+	r := bytes.NewReader(b)
+	var h RequestHeader
+	if read(r, &h) != nil {
+		return
+	}
+	switch h.Action {
+	case ActionConnect:
+		s.handleConnect(addr, h)
+	case ActionAnnounce:
+		s.handleAnnounce(addr, h, r)
+	case ActionScrape:
+		s.handleScrape(addr, h, r)
+	default:
+		s.sendError(addr, h.TransactionId, "unknown action")
+	}
+}
+
+func (s *Server) handleConnect(addr net.Addr, h RequestHeader) {
+	if h.ConnectionId != connectRequestConnectionId {
+		s.sendError(addr, h.TransactionId, "bad connection id")
+		return
+	}
+	id := s.newConnId(addr)
+	var w bytes.Buffer
+	write(&w, ResponseHeader{ActionConnect, h.TransactionId})
+	write(&w, ConnectionResponse{id})
+	s.conn.WriteTo(w.Bytes(), addr)
+}
+
+func (s *Server) handleAnnounce(addr net.Addr, h RequestHeader, r *bytes.Reader) {
+	if !s.checkConnId(addr, h.ConnectionId) {
+		s.sendError(addr, h.TransactionId, "bad connection id")
+		return
+	}
+	var ar AnnounceRequest
+	if read(r, &ar) != nil {
+		s.sendError(addr, h.TransactionId, "bad announce request")
+		return
+	}
+	ip := ipFromAddr(addr)
+	peer := Peer{IP: ip, Port: ar.Port, Left: ar.Left}
+	if s.Authorize != nil {
+		if err := s.Authorize(ar.InfoHash, peer); err != nil {
+			s.sendError(addr, h.TransactionId, err.Error())
+			return
+		}
+	}
+	if ar.Event == Stopped {
+		s.store.DropPeer(ar.InfoHash, peer)
+	} else {
+		s.store.AddPeer(ar.InfoHash, peer)
+	}
+	numWant := int(ar.NumWant)
+	if ar.NumWant < 0 {
+		numWant = 50
+	}
+	peers, err := s.store.Peers(ar.InfoHash, numWant, peer)
+	if err != nil {
+		s.sendError(addr, h.TransactionId, "internal error")
+		return
+	}
+	seeders, leechers, _ := s.store.CountPeers(ar.InfoHash)
+
+	var w bytes.Buffer
+	write(&w, ResponseHeader{ActionAnnounce, h.TransactionId})
+	write(&w, AnnounceResponseHeader{Interval: 120, Leechers: leechers, Seeders: seeders})
+	compactPeersFromServerPeers(peers).WriteBinary(&w)
+	s.conn.WriteTo(w.Bytes(), addr)
+}
+
+func (s *Server) handleScrape(addr net.Addr, h RequestHeader, r *bytes.Reader) {
+	if !s.checkConnId(addr, h.ConnectionId) {
+		s.sendError(addr, h.TransactionId, "bad connection id")
+		return
+	}
+	var w bytes.Buffer
+	write(&w, ResponseHeader{ActionScrape, h.TransactionId})
+	for {
+		var infoHash [20]byte
+		_, err := io.ReadFull(r, infoHash[:])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A trailing partial info-hash: r.Len() wasn't a multiple of
+			// 20, so the request is malformed rather than just finished.
+			s.sendError(addr, h.TransactionId, "bad scrape request")
+			return
+		}
+		seeders, leechers, _ := s.store.CountPeers(infoHash)
+		write(&w, ScrapeResponseFile{Complete: seeders, Incomplete: leechers})
+	}
+	s.conn.WriteTo(w.Bytes(), addr)
+}
+
+func (s *Server) sendError(addr net.Addr, tid int32, msg string) {
+	var w bytes.Buffer
+	write(&w, ResponseHeader{ActionError, tid})
+	w.WriteString(msg)
+	s.conn.WriteTo(w.Bytes(), addr)
+}
+
+func (s *Server) newConnId(addr net.Addr) int64 {
+	return s.connIdForWindow(addr, time.Now())
+}
+
+func (s *Server) checkConnId(addr net.Addr, id int64) bool {
+	now := time.Now()
+	return id == s.connIdForWindow(addr, now) || id == s.connIdForWindow(addr, now.Add(-connTTL))
+}
+
+// connIdForWindow derives the connection ID for addr in the connTTL-sized
+// time window containing t, by HMACing the address and the window index
+// with the server's secret. Two addresses never collide without knowing
+// the secret, and nothing needs to be stored to check an ID back later.
+func (s *Server) connIdForWindow(addr net.Addr, t time.Time) int64 {
+	mac := hmac.New(sha1.New, s.secret[:])
+	io.WriteString(mac, addr.String())
+	binary.Write(mac, binary.BigEndian, t.UnixNano()/int64(connTTL))
+	return int64(binary.BigEndian.Uint64(mac.Sum(nil)))
+}
+
+func ipFromAddr(addr net.Addr) net.IP {
+	if u, ok := addr.(*net.UDPAddr); ok {
+		return u.IP
+	}
+	return nil
+}
+
+func compactPeersFromServerPeers(peers []Peer) util.CompactPeers {
+	cp := make(util.CompactPeers, 0, len(peers))
+	for _, p := range peers {
+		ip4 := p.IP.To4()
+		if ip4 == nil {
+			continue
+		}
+		var b [4]byte
+		copy(b[:], ip4)
+		cp = append(cp, util.CompactPeer{IP: b, Port: int(p.Port)})
+	}
+	return cp
+}
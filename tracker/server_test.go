@@ -0,0 +1,103 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerAnnounceRoundTrip(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s := NewServer(conn, NewMemoryPeerStore())
+	go s.Serve()
+
+	cl, err := New("udp://" + conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var req AnnounceRequest
+	req.InfoHash = [20]byte{1}
+	req.Port = 1234
+	req.NumWant = -1
+	resp, err := cl.Announce(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Seeders != 1 {
+		t.Fatalf("expected to be counted as the lone seeder, got %+v", resp)
+	}
+}
+
+func TestServerConnIdTiedToAddr(t *testing.T) {
+	s := NewServer(nil, nil)
+	a := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1}
+	b := &net.UDPAddr{IP: net.IPv4(5, 6, 7, 8), Port: 1}
+	id := s.newConnId(a)
+	if !s.checkConnId(a, id) {
+		t.Fatal("a connection id should be valid for the address it was issued to")
+	}
+	if s.checkConnId(b, id) {
+		t.Fatal("a connection id should not be valid for a different address")
+	}
+}
+
+func TestServerConnIdExpires(t *testing.T) {
+	s := NewServer(nil, nil)
+	a := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1}
+	old := s.connIdForWindow(a, time.Now().Add(-3*connTTL))
+	if s.checkConnId(a, old) {
+		t.Fatal("a connection id from more than two windows ago should no longer be valid")
+	}
+}
+
+// A scrape request whose info-hash section isn't a multiple of 20 bytes is
+// malformed and should be rejected with an error, not answered with a
+// truncated, zero-padded extra ScrapeResponseFile.
+func TestServerScrapeRejectsPartialInfoHash(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s := NewServer(conn, NewMemoryPeerStore())
+	go s.Serve()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	connId := s.newConnId(client.LocalAddr())
+	var w bytes.Buffer
+	write(&w, RequestHeader{ConnectionId: connId, Action: ActionScrape, TransactionId: 1})
+	w.Write(make([]byte, 25)) // one full info-hash plus 5 trailing bytes
+	if _, err := client.Write(w.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 512)
+	n, err := client.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h ResponseHeader
+	if err := read(bytes.NewReader(b[:n]), &h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Action != ActionError {
+		t.Fatalf("expected an error response to a malformed scrape, got action %d", h.Action)
+	}
+}
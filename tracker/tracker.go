@@ -0,0 +1,87 @@
+// Package tracker implements the HTTP and UDP tracker protocols used to
+// discover peers for a torrent and report our own progress on it.
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/anacrolix/torrent/util"
+)
+
+// Event is sent with an announce to tell the tracker about a lifecycle
+// transition for the torrent.
+type Event int32
+
+const (
+	None Event = iota
+	Completed
+	Started
+	Stopped
+)
+
+// AnnounceRequest is the request body common to both the HTTP and UDP
+// tracker protocols.
+type AnnounceRequest struct {
+	InfoHash   [20]byte
+	PeerId     [20]byte
+	Downloaded int64
+	Left       int64
+	Uploaded   int64
+	Event      Event
+	IPAddress  uint32
+	Key        int32
+	NumWant    int32 // -1 for default.
+	Port       uint16
+}
+
+// AnnounceResponse is the reply to an announce, normalized across both
+// tracker protocols.
+type AnnounceResponse struct {
+	Interval int32 // Minimum seconds the next announce should wait.
+	Leechers int32
+	Seeders  int32
+	Peers    util.CompactPeers
+}
+
+// Client is satisfied by both the HTTP and UDP tracker implementations, so
+// callers can announce without caring which protocol a particular tracker
+// URL uses. Scrape is implemented only by the UDP client; the HTTP
+// client's Scrape always returns an error.
+type Client interface {
+	Announce(ctx context.Context, req AnnounceRequest) (AnnounceResponse, error)
+	Scrape(ctx context.Context, infoHashes [][20]byte) (ScrapeResponse, error)
+	Close() error
+}
+
+// ScrapeResponse carries the swarm stats for each requested info hash, in
+// the same order they were requested.
+type ScrapeResponse struct {
+	Files []ScrapeResponseFile
+}
+
+// ScrapeResponseFile is one torrent's worth of scrape data.
+type ScrapeResponseFile struct {
+	Complete   int32
+	Downloaded int32
+	Incomplete int32
+}
+
+// New returns a Client for the tracker at rawurl. The scheme determines
+// which protocol implementation is used; everything after that, callers
+// don't need to know about.
+func New(rawurl string) (Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "udp":
+		return NewConnClient(u)
+	case "http", "https":
+		return newHTTPClient(u), nil
+	default:
+		return nil, fmt.Errorf("unsupported tracker scheme: %q", u.Scheme)
+	}
+}
@@ -0,0 +1,326 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/util"
+)
+
+// BEP 15 actions.
+const (
+	ActionConnect int32 = iota
+	ActionAnnounce
+	ActionScrape
+	ActionError
+)
+
+// connectRequestConnectionId is the magic connection ID a client uses for
+// its very first Connect request, per BEP 15.
+const connectRequestConnectionId = 0x41727101980
+
+// connIdLifetime is how long a connection ID may be reused for further
+// announces/scrapes before it must be refreshed, per BEP 15.
+const connIdLifetime = 2 * time.Minute
+
+// defaultRetransmitInterval is the base interval roundTrip waits before its
+// first retransmit, per BEP 15 (15s * 2^n, capped at n=8). It's a
+// ConnClient field rather than a literal so tests can shrink it instead of
+// waiting out real backoffs.
+const defaultRetransmitInterval = 15 * time.Second
+
+// RequestHeader is the 16-byte header on every UDP tracker request after
+// the initial connect.
+type RequestHeader struct {
+	ConnectionId  int64
+	Action        int32
+	TransactionId int32
+}
+
+// ResponseHeader is the 8-byte header on every UDP tracker response.
+type ResponseHeader struct {
+	Action        int32
+	TransactionId int32
+}
+
+// ConnectionResponse is the body of a successful connect response.
+type ConnectionResponse struct {
+	ConnectionId int64
+}
+
+// AnnounceResponseHeader is the fixed part of an announce response body,
+// following the common ResponseHeader.
+type AnnounceResponseHeader struct {
+	Interval int32
+	Leechers int32
+	Seeders  int32
+}
+
+func read(r io.Reader, data interface{}) error {
+	return binary.Read(r, binary.BigEndian, data)
+}
+
+func write(w io.Writer, data interface{}) error {
+	return binary.Write(w, binary.BigEndian, data)
+}
+
+// urlDataOption is the BEP 15 optional-parameter tag used to tell a
+// tracker which of several torrents it's multiplexing behind one UDP port
+// this request is for, via the URL's path.
+const urlDataOption = 2
+
+// udpTransaction is an in-flight request waiting for its reply, keyed by
+// transaction ID in ConnClient.transactions.
+type udpTransaction struct {
+	response chan []byte
+}
+
+// ConnClient is a long-lived UDP tracker client: a single socket shared by
+// every Announce/Scrape made through it, multiplexed by transaction ID, so
+// callers don't pay for a fresh Connect handshake on every request.
+type ConnClient struct {
+	url  *url.URL
+	conn net.Conn
+
+	mu           sync.Mutex
+	transactions map[int32]*udpTransaction
+	nextTid      int32
+	connId       int64
+	connIdAt     time.Time
+
+	retransmitInterval time.Duration
+
+	closed chan struct{}
+}
+
+// NewConnClient dials the UDP tracker named by u and returns a ConnClient
+// ready to serve Announce and Scrape calls for it.
+func NewConnClient(u *url.URL) (*ConnClient, error) {
+	conn, err := net.Dial("udp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	cc := &ConnClient{
+		url:                u,
+		conn:               conn,
+		transactions:       make(map[int32]*udpTransaction),
+		retransmitInterval: defaultRetransmitInterval,
+		closed:             make(chan struct{}),
+	}
+	go cc.readLoop()
+	return cc, nil
+}
+
+func (me *ConnClient) Close() error {
+	select {
+	case <-me.closed:
+	default:
+		close(me.closed)
+	}
+	return me.conn.Close()
+}
+
+func (me *ConnClient) readLoop() {
+	b := make([]byte, 0x800)
+	for {
+		n, err := me.conn.Read(b)
+		if err != nil {
+			return
+		}
+		if n < 8 {
+			continue
+		}
+		var h ResponseHeader
+		if err := read(bytes.NewReader(b[:8]), &h); err != nil {
+			continue
+		}
+		me.mu.Lock()
+		t, ok := me.transactions[h.TransactionId]
+		me.mu.Unlock()
+		if !ok {
+			continue
+		}
+		payload := make([]byte, n)
+		copy(payload, b[:n])
+		select {
+		case t.response <- payload:
+		default:
+		}
+	}
+}
+
+func (me *ConnClient) newTransactionId() int32 {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.nextTid++
+	return me.nextTid
+}
+
+// roundTrip sends b repeatedly, backing off per BEP 15 (15s * 2^n, capped
+// at n=8), until a reply for tid arrives, ctx is done, or retries are
+// exhausted.
+func (me *ConnClient) roundTrip(ctx context.Context, tid int32, b []byte) ([]byte, error) {
+	t := &udpTransaction{response: make(chan []byte, 1)}
+	me.mu.Lock()
+	me.transactions[tid] = t
+	me.mu.Unlock()
+	defer func() {
+		me.mu.Lock()
+		delete(me.transactions, tid)
+		me.mu.Unlock()
+	}()
+
+	for n := 0; n <= 8; n++ {
+		if _, err := me.conn.Write(b); err != nil {
+			return nil, err
+		}
+		timer := time.NewTimer(me.retransmitInterval * (1 << uint(n)))
+		select {
+		case resp := <-t.response:
+			timer.Stop()
+			return resp, nil
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-me.closed:
+			timer.Stop()
+			return nil, fmt.Errorf("tracker client closed")
+		case <-timer.C:
+		}
+	}
+	return nil, fmt.Errorf("timed out after retransmit backoff exhausted")
+}
+
+// getConnId returns a connection ID valid for use right now, performing a
+// Connect handshake if none is cached or the cached one has expired.
+func (me *ConnClient) getConnId(ctx context.Context) (int64, error) {
+	me.mu.Lock()
+	if !me.connIdAt.IsZero() && time.Since(me.connIdAt) < connIdLifetime {
+		id := me.connId
+		me.mu.Unlock()
+		return id, nil
+	}
+	me.mu.Unlock()
+
+	tid := me.newTransactionId()
+	var buf bytes.Buffer
+	write(&buf, RequestHeader{connectRequestConnectionId, ActionConnect, tid})
+	resp, err := me.roundTrip(ctx, tid, buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	r := bytes.NewReader(resp)
+	var h ResponseHeader
+	if err := read(r, &h); err != nil {
+		return 0, err
+	}
+	if h.Action != ActionConnect {
+		return 0, fmt.Errorf("unexpected action in connect response: %d", h.Action)
+	}
+	var cr ConnectionResponse
+	if err := read(r, &cr); err != nil {
+		return 0, err
+	}
+	me.mu.Lock()
+	me.connId = cr.ConnectionId
+	me.connIdAt = time.Now()
+	me.mu.Unlock()
+	return cr.ConnectionId, nil
+}
+
+func (me *ConnClient) Announce(ctx context.Context, ar AnnounceRequest) (AnnounceResponse, error) {
+	connId, err := me.getConnId(ctx)
+	if err != nil {
+		return AnnounceResponse{}, err
+	}
+	tid := me.newTransactionId()
+	var buf bytes.Buffer
+	write(&buf, RequestHeader{connId, ActionAnnounce, tid})
+	write(&buf, ar)
+	if me.url.Path != "" {
+		buf.WriteByte(urlDataOption)
+		buf.WriteByte(byte(len(me.url.Path)))
+		buf.WriteString(me.url.Path)
+	}
+
+	resp, err := me.roundTrip(ctx, tid, buf.Bytes())
+	if err != nil {
+		return AnnounceResponse{}, err
+	}
+	r := bytes.NewReader(resp)
+	var h ResponseHeader
+	if err := read(r, &h); err != nil {
+		return AnnounceResponse{}, err
+	}
+	if h.Action == ActionError {
+		msg, _ := ioutil.ReadAll(r)
+		return AnnounceResponse{}, fmt.Errorf("tracker gave error: %q", msg)
+	}
+	if h.Action != ActionAnnounce {
+		return AnnounceResponse{}, fmt.Errorf("unexpected action in announce response: %d", h.Action)
+	}
+	var ah AnnounceResponseHeader
+	if err := read(r, &ah); err != nil {
+		return AnnounceResponse{}, err
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		return AnnounceResponse{}, err
+	}
+	peers, err := peersFromBytes(rest)
+	if err != nil {
+		return AnnounceResponse{}, err
+	}
+	return AnnounceResponse{
+		Interval: ah.Interval,
+		Leechers: ah.Leechers,
+		Seeders:  ah.Seeders,
+		Peers:    peers,
+	}, nil
+}
+
+func (me *ConnClient) Scrape(ctx context.Context, infoHashes [][20]byte) (ScrapeResponse, error) {
+	connId, err := me.getConnId(ctx)
+	if err != nil {
+		return ScrapeResponse{}, err
+	}
+	tid := me.newTransactionId()
+	var buf bytes.Buffer
+	write(&buf, RequestHeader{connId, ActionScrape, tid})
+	for _, ih := range infoHashes {
+		buf.Write(ih[:])
+	}
+	resp, err := me.roundTrip(ctx, tid, buf.Bytes())
+	if err != nil {
+		return ScrapeResponse{}, err
+	}
+	r := bytes.NewReader(resp)
+	var h ResponseHeader
+	if err := read(r, &h); err != nil {
+		return ScrapeResponse{}, err
+	}
+	if h.Action != ActionScrape {
+		return ScrapeResponse{}, fmt.Errorf("unexpected action in scrape response: %d", h.Action)
+	}
+	sr := ScrapeResponse{Files: make([]ScrapeResponseFile, 0, len(infoHashes))}
+	for range infoHashes {
+		var f ScrapeResponseFile
+		if err := read(r, &f); err != nil {
+			return ScrapeResponse{}, err
+		}
+		sr.Files = append(sr.Files, f)
+	}
+	return sr, nil
+}
+
+func peersFromBytes(b []byte) (util.CompactPeers, error) {
+	return util.UnmarshalCompactPeers(b)
+}
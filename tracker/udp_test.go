@@ -2,16 +2,17 @@ package tracker
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"io"
 	"io/ioutil"
-	"log"
 	"net"
 	"net/url"
 	"sync"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/anacrolix/torrent/util"
 )
@@ -93,17 +94,16 @@ func TestUDPTracker(t *testing.T) {
 	if err != nil {
 		t.Skip(err)
 	}
-	if err := tr.Connect(); err != nil {
-		t.Skip(err)
-	}
+	defer tr.Close()
 	req := AnnounceRequest{
 		NumWant: -1,
 		Event:   Started,
 	}
 	rand.Read(req.PeerId[:])
 	copy(req.InfoHash[:], []uint8{0xa3, 0x56, 0x41, 0x43, 0x74, 0x23, 0xe6, 0x26, 0xd9, 0x38, 0x25, 0x4a, 0x6b, 0x80, 0x49, 0x10, 0xa6, 0x67, 0xa, 0xc1})
-	_, err = tr.Announce(&req)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if _, err = tr.Announce(ctx, req); err != nil {
 		t.Skip(err)
 	}
 }
@@ -119,32 +119,31 @@ func TestAnnounceRandomInfoHash(t *testing.T) {
 	rand.Read(req.PeerId[:])
 	rand.Read(req.InfoHash[:])
 	wg := sync.WaitGroup{}
-	for _, url := range []string{
+	for _, u := range []string{
 		"udp://tracker.openbittorrent.com:80/announce",
 		"udp://tracker.publicbt.com:80",
 		"udp://tracker.istole.it:6969",
 		"udp://tracker.ccc.de:80",
 		"udp://tracker.open.demonii.com:1337",
 	} {
-		go func(url string) {
+		go func(u string) {
 			defer wg.Done()
-			tr, err := New(url)
+			tr, err := New(u)
 			if err != nil {
 				t.Fatal(err)
 			}
-			if err := tr.Connect(); err != nil {
-				t.Log(err)
-				return
-			}
-			resp, err := tr.Announce(&req)
+			defer tr.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			defer cancel()
+			resp, err := tr.Announce(ctx, req)
 			if err != nil {
-				t.Logf("error announcing to %s: %s", url, err)
+				t.Logf("error announcing to %s: %s", u, err)
 				return
 			}
 			if resp.Leechers != 0 || resp.Seeders != 0 || len(resp.Peers) != 0 {
 				t.Fatal(resp)
 			}
-		}(url)
+		}(u)
 		wg.Add(1)
 	}
 	wg.Wait()
@@ -157,19 +156,20 @@ func TestURLPathOption(t *testing.T) {
 		panic(err)
 	}
 	defer conn.Close()
-	cl := newClient(&url.URL{
+	cl, err := NewConnClient(&url.URL{
 		Host: conn.LocalAddr().String(),
 		Path: "/announce",
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	done := make(chan struct{})
 	go func() {
-		err = cl.Connect()
-		if err != nil {
-			t.Fatal(err)
-		}
-		log.Print("connected")
-		_, err = cl.Announce(&AnnounceRequest{})
+		defer close(done)
+		_, err := cl.Announce(context.Background(), AnnounceRequest{})
 		if err != nil {
-			t.Fatal(err)
+			t.Error(err)
 		}
 	}()
 	var b [512]byte
@@ -179,6 +179,7 @@ func TestURLPathOption(t *testing.T) {
 	read(r, &h)
 	w := &bytes.Buffer{}
 	write(w, ResponseHeader{
+		Action:        ActionConnect,
 		TransactionId: h.TransactionId,
 	})
 	write(w, ConnectionResponse{42})
@@ -193,8 +194,211 @@ func TestURLPathOption(t *testing.T) {
 	}
 	w = &bytes.Buffer{}
 	write(w, ResponseHeader{
+		Action:        ActionAnnounce,
 		TransactionId: h.TransactionId,
 	})
 	write(w, AnnounceResponseHeader{})
 	conn.WriteTo(w.Bytes(), addr)
+	<-done
+}
+
+// fakeUDPTrackerConn is a raw UDP socket a test reads ConnClient's requests
+// from and writes hand-built responses to, for driving its wire behavior
+// directly.
+type fakeUDPTrackerConn struct {
+	*net.UDPConn
+}
+
+func (f *fakeUDPTrackerConn) readRequest(t *testing.T) (RequestHeader, net.Addr) {
+	var b [512]byte
+	n, addr, err := f.ReadFrom(b[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h RequestHeader
+	if err := read(bytes.NewReader(b[:n]), &h); err != nil {
+		t.Fatal(err)
+	}
+	return h, addr
+}
+
+func (f *fakeUDPTrackerConn) writeConnectResponse(t *testing.T, addr net.Addr, tid int32, connId int64) {
+	w := &bytes.Buffer{}
+	write(w, ResponseHeader{Action: ActionConnect, TransactionId: tid})
+	write(w, ConnectionResponse{connId})
+	if _, err := f.WriteTo(w.Bytes(), addr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fakeUDPTrackerConn) writeAnnounceResponse(t *testing.T, addr net.Addr, tid int32, interval int32) {
+	w := &bytes.Buffer{}
+	write(w, ResponseHeader{Action: ActionAnnounce, TransactionId: tid})
+	write(w, AnnounceResponseHeader{Interval: interval})
+	if _, err := f.WriteTo(w.Bytes(), addr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newFakeUDPTracker(t *testing.T) (*fakeUDPTrackerConn, *ConnClient) {
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := NewConnClient(&url.URL{Host: conn.LocalAddr().String()})
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	return &fakeUDPTrackerConn{conn}, cl
+}
+
+// getConnId must not reuse a cached connection id past connIdLifetime: once
+// it's stale, the next call should perform a fresh Connect handshake rather
+// than keep using the expired id.
+func TestConnClientRefreshesExpiredConnId(t *testing.T) {
+	f, cl := newFakeUDPTracker(t)
+	defer f.Close()
+	defer cl.Close()
+
+	connects := 0
+	announceOnce := func(interval int32) error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := cl.Announce(context.Background(), AnnounceRequest{})
+			done <- err
+		}()
+		h, addr := f.readRequest(t)
+		if h.Action != ActionConnect {
+			t.Fatalf("expected a connect request, got action %d", h.Action)
+		}
+		connects++
+		f.writeConnectResponse(t, addr, h.TransactionId, int64(connects))
+		h, addr = f.readRequest(t)
+		if h.Action != ActionAnnounce {
+			t.Fatalf("expected an announce request, got action %d", h.Action)
+		}
+		f.writeAnnounceResponse(t, addr, h.TransactionId, interval)
+		return <-done
+	}
+
+	if err := announceOnce(100); err != nil {
+		t.Fatal(err)
+	}
+	if connects != 1 {
+		t.Fatalf("expected 1 connect handshake, got %d", connects)
+	}
+
+	// A second announce within connIdLifetime should reuse the cached id
+	// and skip straight to announcing.
+	done := make(chan error, 1)
+	go func() {
+		_, err := cl.Announce(context.Background(), AnnounceRequest{})
+		done <- err
+	}()
+	h, addr := f.readRequest(t)
+	if h.Action != ActionAnnounce {
+		t.Fatalf("expected the cached connection id to be reused, got action %d", h.Action)
+	}
+	f.writeAnnounceResponse(t, addr, h.TransactionId, 150)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if connects != 1 {
+		t.Fatalf("a still-fresh connection id should not trigger another connect, got %d total connects", connects)
+	}
+
+	// Make the cached id look expired; the next announce must reconnect.
+	cl.mu.Lock()
+	cl.connIdAt = time.Now().Add(-2 * connIdLifetime)
+	cl.mu.Unlock()
+
+	if err := announceOnce(200); err != nil {
+		t.Fatal(err)
+	}
+	if connects != 2 {
+		t.Fatalf("expected getConnId to reconnect after expiry, got %d total connects", connects)
+	}
+}
+
+// Two concurrent Announce calls multiplexed over the same socket must each
+// get back the response matching their own transaction id, even when the
+// tracker answers them out of order.
+func TestConnClientMultiplexesConcurrentTransactions(t *testing.T) {
+	f, cl := newFakeUDPTracker(t)
+	defer f.Close()
+	defer cl.Close()
+
+	// Prime a connection id so both Announces go straight to announcing.
+	go func() {
+		h, addr := f.readRequest(t)
+		f.writeConnectResponse(t, addr, h.TransactionId, 7)
+	}()
+	if _, err := cl.getConnId(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	res1 := make(chan AnnounceResponse, 1)
+	res2 := make(chan AnnounceResponse, 1)
+	go func() {
+		r, err := cl.Announce(context.Background(), AnnounceRequest{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		res1 <- r
+	}()
+	go func() {
+		r, err := cl.Announce(context.Background(), AnnounceRequest{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		res2 <- r
+	}()
+
+	h1, addr1 := f.readRequest(t)
+	h2, addr2 := f.readRequest(t)
+	// Answer in reverse order, with distinguishable intervals, to prove
+	// responses are matched by transaction id and not by send order.
+	f.writeAnnounceResponse(t, addr2, h2.TransactionId, 222)
+	f.writeAnnounceResponse(t, addr1, h1.TransactionId, 111)
+
+	got := map[int32]bool{(<-res1).Interval: true, (<-res2).Interval: true}
+	if !got[111] || !got[222] {
+		t.Fatalf("expected responses matched by transaction id to carry intervals 111 and 222, got %v", got)
+	}
+}
+
+// roundTrip must retransmit the request if no response arrives within the
+// backoff interval, rather than giving up after a single send.
+func TestConnClientRetransmitsOnNoResponse(t *testing.T) {
+	f, cl := newFakeUDPTracker(t)
+	defer f.Close()
+	defer cl.Close()
+	cl.retransmitInterval = 20 * time.Millisecond
+
+	writes := 0
+	go func() {
+		for {
+			h, addr := f.readRequest(t)
+			writes++
+			if writes < 3 {
+				continue // drop the first two sends to force retransmits
+			}
+			f.writeConnectResponse(t, addr, h.TransactionId, 9)
+			return
+		}
+	}()
+
+	id, err := cl.getConnId(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 9 {
+		t.Fatalf("got connection id %d", id)
+	}
+	if writes < 3 {
+		t.Fatalf("expected roundTrip to retransmit until a response arrived, only saw %d writes", writes)
+	}
 }
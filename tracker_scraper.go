@@ -0,0 +1,297 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/tracker"
+	"github.com/anacrolix/torrent/util"
+)
+
+// errNoTrackers is returned when a torrent has no announce-list tiers at
+// all, so there's nothing for a trackerScraper to try.
+var errNoTrackers = errors.New("no trackers")
+
+func netIPFromCompact(b [4]byte) net.IP {
+	return net.IP(b[:])
+}
+
+// announceList is a BEP 12 announce-list: tiers of tracker URLs. Trackers
+// within a tier are tried in a random order; the whole tier is considered
+// failed only once every tracker in it has failed.
+type announceList [][]string
+
+// trackerTierStats is what a trackerScraper remembers about a single
+// tracker URL, for status reporting.
+type trackerTierStats struct {
+	LastAnnounce time.Time
+	LastError    error
+}
+
+// trackerScraperStatus func() (downloaded, left, uploaded int64) lets
+// trackerScraper ask its torrent for the numbers to put in an announce
+// without depending on the torrent's internals.
+type trackerScraperStatus func() (downloaded, left, uploaded int64)
+
+// trackerScraper is owned by a single torrent. It walks the torrent's
+// announce-list tiers per BEP 12, respects the interval (or min_interval)
+// a tracker asks for, sends started/completed/stopped at the right
+// lifecycle transitions, and backs off exponentially with jitter when
+// every tracker in every tier fails.
+type trackerScraper struct {
+	client   *Client
+	infoHash InfoHash
+	peerID   [20]byte
+	port     uint16
+	status   trackerScraperStatus
+
+	// newPeers is called with every batch of peers a successful announce
+	// returns, so they can be fed into the torrent's peer pool.
+	newPeers func(util.CompactPeers)
+
+	mu        sync.Mutex
+	tiers     announceList
+	stats     map[string]*trackerTierStats
+	conns     map[string]tracker.Client
+	completed bool
+	wake      chan struct{}
+}
+
+// newTrackerScraper returns a trackerScraper for infoHash that will
+// announce across tiers, reporting progress via status and delivering
+// discovered peers via newPeers.
+func newTrackerScraper(client *Client, infoHash InfoHash, peerID [20]byte, port uint16, tiers announceList, status trackerScraperStatus, newPeers func(util.CompactPeers)) *trackerScraper {
+	return &trackerScraper{
+		client:   client,
+		infoHash: infoHash,
+		peerID:   peerID,
+		port:     port,
+		status:   status,
+		newPeers: newPeers,
+		tiers:    tiers,
+		stats:    make(map[string]*trackerTierStats),
+		conns:    make(map[string]tracker.Client),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Completed tells Run to send a "completed" event on its next announce, as
+// soon as possible, instead of waiting out the current interval. It's a
+// no-op if the torrent has already been marked completed.
+func (me *trackerScraper) Completed() {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.completed {
+		return
+	}
+	me.completed = true
+	select {
+	case me.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextEvent returns the event to send on the next announce: tracker.Completed
+// exactly once, if Completed has been called since the last announce, and
+// tracker.None otherwise.
+func (me *trackerScraper) nextEvent() tracker.Event {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.completed {
+		me.completed = false
+		return tracker.Completed
+	}
+	return tracker.None
+}
+
+// Stats returns what's known about the last announce to url, if anything.
+func (me *trackerScraper) Stats(url string) (stats trackerTierStats, ok bool) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	s, ok := me.stats[url]
+	if !ok {
+		return
+	}
+	return *s, true
+}
+
+// Run announces in a loop, respecting the interval each successful
+// announce returns, until ctx is done. It sends a "started" event on the
+// first announce, a "completed" event as soon as possible after Completed
+// is called, and a best-effort "stopped" event when ctx is done.
+func (me *trackerScraper) Run(ctx context.Context) {
+	event := tracker.Started
+	backoff := time.Second
+	for {
+		interval, err := me.announceOnce(ctx, event)
+		if err == nil {
+			backoff = time.Second
+		} else {
+			backoff *= 2
+			if backoff > time.Hour {
+				backoff = time.Hour
+			}
+			interval = backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+		}
+		select {
+		case <-ctx.Done():
+			me.announceStopped()
+			return
+		case <-me.wake:
+		case <-time.After(interval):
+		}
+		// Recompute the event right before it's used, rather than right
+		// after the previous announce, so a Completed call that lands
+		// during the wait above is picked up by the announce it wakes,
+		// not the one after that.
+		event = me.nextEvent()
+	}
+}
+
+// announceOnce walks the tiers once, returning the interval the
+// responding tracker asked for. A tracker that responds is promoted to
+// the front of its tier, per BEP 12.
+func (me *trackerScraper) announceOnce(ctx context.Context, event tracker.Event) (time.Duration, error) {
+	me.mu.Lock()
+	tiers := me.tiers
+	me.mu.Unlock()
+
+	var lastErr error
+	for _, tier := range tiers {
+		order := rand.Perm(len(tier))
+		for _, idx := range order {
+			url := tier[idx]
+			resp, err := me.announceTo(ctx, url, event)
+			if err != nil {
+				lastErr = err
+				me.recordError(url, err)
+				continue
+			}
+			me.recordSuccess(url)
+			me.promote(tier, idx)
+			if resp.Interval <= 0 {
+				return time.Minute, nil
+			}
+			return time.Duration(resp.Interval) * time.Second, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = errNoTrackers
+	}
+	return 0, lastErr
+}
+
+func (me *trackerScraper) announceTo(ctx context.Context, url string, event tracker.Event) (tracker.AnnounceResponse, error) {
+	cl, err := me.clientFor(url)
+	if err != nil {
+		return tracker.AnnounceResponse{}, err
+	}
+	downloaded, left, uploaded := me.status()
+	req := tracker.AnnounceRequest{
+		InfoHash:   me.infoHash,
+		PeerId:     me.peerID,
+		Downloaded: downloaded,
+		Left:       left,
+		Uploaded:   uploaded,
+		Event:      event,
+		NumWant:    -1,
+		Port:       me.port,
+	}
+	resp, err := cl.Announce(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if me.newPeers != nil && len(resp.Peers) != 0 {
+		me.newPeers(me.filterBanned(resp.Peers))
+	}
+	return resp, nil
+}
+
+func (me *trackerScraper) filterBanned(peers util.CompactPeers) util.CompactPeers {
+	if me.client == nil {
+		return peers
+	}
+	filtered := peers[:0:0]
+	for _, p := range peers {
+		if !me.client.IsBannedPeerIP(netIPFromCompact(p.IP)) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+func (me *trackerScraper) clientFor(url string) (tracker.Client, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if cl, ok := me.conns[url]; ok {
+		return cl, nil
+	}
+	cl, err := tracker.New(url)
+	if err != nil {
+		return nil, err
+	}
+	me.conns[url] = cl
+	return cl, nil
+}
+
+// promote moves the tracker at position i in tier to the front, so it's
+// tried first next time, per BEP 12.
+func (me *trackerScraper) promote(tier []string, i int) {
+	if i == 0 {
+		return
+	}
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	url := tier[i]
+	copy(tier[1:i+1], tier[:i])
+	tier[0] = url
+}
+
+func (me *trackerScraper) recordError(url string, err error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	s := me.statsFor(url)
+	s.LastError = err
+}
+
+func (me *trackerScraper) recordSuccess(url string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	s := me.statsFor(url)
+	s.LastAnnounce = time.Now()
+	s.LastError = nil
+}
+
+func (me *trackerScraper) statsFor(url string) *trackerTierStats {
+	s, ok := me.stats[url]
+	if !ok {
+		s = &trackerTierStats{}
+		me.stats[url] = s
+	}
+	return s
+}
+
+// announceStopped tells every tracker a client has been opened for, whether
+// or not its announces succeeded, that we're leaving, on a best-effort basis.
+func (me *trackerScraper) announceStopped() {
+	me.mu.Lock()
+	conns := make(map[string]tracker.Client, len(me.conns))
+	for url, cl := range me.conns {
+		conns[url] = cl
+	}
+	me.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, cl := range conns {
+		cl.Announce(ctx, tracker.AnnounceRequest{
+			InfoHash: me.infoHash,
+			PeerId:   me.peerID,
+			Event:    tracker.Stopped,
+			Port:     me.port,
+		})
+	}
+}
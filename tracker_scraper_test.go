@@ -0,0 +1,133 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/tracker"
+	"github.com/anacrolix/torrent/util"
+)
+
+func TestTrackerScraperPromote(t *testing.T) {
+	ts := newTrackerScraper(nil, InfoHash{}, [20]byte{}, 0, nil, nil, nil)
+	tier := []string{"a", "b", "c"}
+	ts.promote(tier, 2)
+	if !reflect.DeepEqual(tier, []string{"c", "a", "b"}) {
+		t.Fatalf("got %v", tier)
+	}
+}
+
+func TestTrackerScraperFilterBanned(t *testing.T) {
+	cl := NewClient(ClientConfig{})
+	cl.BanPeerIP(net.IPv4(1, 2, 3, 4))
+	ts := newTrackerScraper(cl, InfoHash{}, [20]byte{}, 0, nil, nil, nil)
+	peers := util.CompactPeers{
+		{IP: [4]byte{1, 2, 3, 4}, Port: 1},
+		{IP: [4]byte{5, 6, 7, 8}, Port: 2},
+	}
+	got := ts.filterBanned(peers)
+	if len(got) != 1 || got[0].Port != 2 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestTrackerScraperCompleted(t *testing.T) {
+	ts := newTrackerScraper(nil, InfoHash{}, [20]byte{}, 0, nil, nil, nil)
+	if ts.nextEvent() != tracker.None {
+		t.Fatal("nextEvent should be None before Completed is called")
+	}
+	ts.Completed()
+	select {
+	case <-ts.wake:
+	default:
+		t.Fatal("Completed should wake Run")
+	}
+	if ts.nextEvent() != tracker.Completed {
+		t.Fatal("nextEvent should be Completed once, after Completed is called")
+	}
+	if ts.nextEvent() != tracker.None {
+		t.Fatal("nextEvent should fall back to None after Completed is consumed")
+	}
+	// Calling Completed again once consumed should work the same way.
+	ts.Completed()
+	ts.Completed()
+	if ts.nextEvent() != tracker.Completed {
+		t.Fatal("a second Completed call should still request a Completed event")
+	}
+}
+
+// fakeTrackerClient is a tracker.Client that either always fails with err,
+// or, if seen is non-nil, records the event of every Announce it receives
+// by sending it there.
+type fakeTrackerClient struct {
+	seen chan tracker.Event
+	err  error
+}
+
+func (f *fakeTrackerClient) Announce(ctx context.Context, req tracker.AnnounceRequest) (tracker.AnnounceResponse, error) {
+	if f.err != nil {
+		return tracker.AnnounceResponse{}, f.err
+	}
+	if f.seen != nil {
+		f.seen <- req.Event
+	}
+	return tracker.AnnounceResponse{Interval: 3600}, nil
+}
+
+func (f *fakeTrackerClient) Scrape(ctx context.Context, infoHashes [][20]byte) (tracker.ScrapeResponse, error) {
+	return tracker.ScrapeResponse{}, nil
+}
+
+func (f *fakeTrackerClient) Close() error { return nil }
+
+// Calling Completed while Run is waiting out a long interval should make
+// the very next announce a Completed one, not a stale None that was
+// computed before Completed was called.
+func TestTrackerScraperRunSendsCompletedPromptly(t *testing.T) {
+	fake := &fakeTrackerClient{seen: make(chan tracker.Event, 4)}
+	ts := newTrackerScraper(nil, InfoHash{}, [20]byte{}, 0, announceList{{"fake"}}, func() (int64, int64, int64) { return 0, 0, 0 }, nil)
+	ts.conns["fake"] = fake
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ts.Run(ctx)
+
+	if got := <-fake.seen; got != tracker.Started {
+		t.Fatalf("expected first announce to be Started, got %v", got)
+	}
+	ts.Completed()
+	select {
+	case got := <-fake.seen:
+		if got != tracker.Completed {
+			t.Fatalf("expected the announce woken by Completed to carry Completed, got %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Completed did not trigger a prompt announce")
+	}
+}
+
+// announceOnce must promote whichever tracker actually responded, not
+// whatever tracker happens to sit at the same index in tier as the
+// responder's position in the random try order. Since the try order is
+// randomized, repeat enough times that a promote call using the wrong
+// index would be caught with overwhelming probability.
+func TestTrackerScraperAnnounceOncePromotesRespondingTracker(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		tier := []string{"a", "b", "c"}
+		ts := newTrackerScraper(nil, InfoHash{}, [20]byte{}, 0, announceList{tier}, func() (int64, int64, int64) { return 0, 0, 0 }, nil)
+		ts.conns["a"] = &fakeTrackerClient{err: errors.New("a down")}
+		ts.conns["b"] = &fakeTrackerClient{err: errors.New("b down")}
+		ts.conns["c"] = &fakeTrackerClient{}
+
+		if _, err := ts.announceOnce(context.Background(), tracker.None); err != nil {
+			t.Fatal(err)
+		}
+		if tier[0] != "c" {
+			t.Fatalf("expected c, the tracker that actually responded, to be promoted to the front; got %v", tier)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package util holds small self-contained helpers shared by the tracker,
+// DHT, and peer-exchange code, starting with the "compact" peer encodings
+// used on the wire by all three.
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// CompactPeer is a single IPv4 peer address as seen in a compact peer
+// list: 4 bytes of big-endian IP followed by 2 bytes of big-endian port.
+type CompactPeer struct {
+	IP   [4]byte
+	Port int
+}
+
+// CompactPeers is a list of IPv4 peers in the compact representation used
+// by HTTP and UDP tracker responses and by ut_pex's "added"/"dropped"
+// keys.
+type CompactPeers []CompactPeer
+
+// WriteBinary appends the compact encoding of each peer to w.
+func (cp CompactPeers) WriteBinary(w io.Writer) error {
+	for _, p := range cp {
+		if _, err := w.Write(p.IP[:]); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, uint16(p.Port)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal returns the compact encoding of cp.
+func (cp CompactPeers) Marshal() []byte {
+	var buf bytes.Buffer
+	cp.WriteBinary(&buf)
+	return buf.Bytes()
+}
+
+// MarshalBencode encodes cp as a single bencode byte-string of packed
+// addresses, the representation ut_pex and the trackers actually use on
+// the wire, rather than as a bencode list of dictionaries.
+func (cp CompactPeers) MarshalBencode() ([]byte, error) {
+	return bencode.MarshalRawBytes(cp.Marshal()), nil
+}
+
+// UnmarshalBencode decodes the raw bytes of a bencode string, as handed to
+// it by the bencode package, into cp.
+func (cp *CompactPeers) UnmarshalBencode(b []byte) (err error) {
+	*cp, err = UnmarshalCompactPeers(b)
+	return
+}
+
+// UnmarshalCompactPeers decodes b, which must be a multiple of 6 bytes
+// long, into a CompactPeers.
+func UnmarshalCompactPeers(b []byte) (CompactPeers, error) {
+	if len(b)%6 != 0 {
+		return nil, fmt.Errorf("bad compact peers length: %d", len(b))
+	}
+	cp := make(CompactPeers, 0, len(b)/6)
+	for len(b) != 0 {
+		var p CompactPeer
+		copy(p.IP[:], b[:4])
+		p.Port = int(binary.BigEndian.Uint16(b[4:6]))
+		cp = append(cp, p)
+		b = b[6:]
+	}
+	return cp, nil
+}
+
+// CompactIPv6Peer is the IPv6 analog of CompactPeer: 16 bytes of IP
+// followed by 2 bytes of big-endian port.
+type CompactIPv6Peer struct {
+	IP   [16]byte
+	Port int
+}
+
+// CompactIPv6Peers is a list of IPv6 peers in the compact representation
+// used by ut_pex's "added6"/"dropped6" keys.
+type CompactIPv6Peers []CompactIPv6Peer
+
+// WriteBinary appends the compact encoding of each peer to w.
+func (cp CompactIPv6Peers) WriteBinary(w io.Writer) error {
+	for _, p := range cp {
+		if _, err := w.Write(p.IP[:]); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, uint16(p.Port)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal returns the compact encoding of cp.
+func (cp CompactIPv6Peers) Marshal() []byte {
+	var buf bytes.Buffer
+	cp.WriteBinary(&buf)
+	return buf.Bytes()
+}
+
+// MarshalBencode encodes cp as a single bencode byte-string of packed
+// addresses, as used by ut_pex's "added6"/"dropped6" keys.
+func (cp CompactIPv6Peers) MarshalBencode() ([]byte, error) {
+	return bencode.MarshalRawBytes(cp.Marshal()), nil
+}
+
+// UnmarshalBencode decodes the raw bytes of a bencode string, as handed to
+// it by the bencode package, into cp.
+func (cp *CompactIPv6Peers) UnmarshalBencode(b []byte) (err error) {
+	*cp, err = UnmarshalCompactIPv6Peers(b)
+	return
+}
+
+// UnmarshalCompactIPv6Peers decodes b, which must be a multiple of 18
+// bytes long, into a CompactIPv6Peers.
+func UnmarshalCompactIPv6Peers(b []byte) (CompactIPv6Peers, error) {
+	if len(b)%18 != 0 {
+		return nil, fmt.Errorf("bad compact ipv6 peers length: %d", len(b))
+	}
+	cp := make(CompactIPv6Peers, 0, len(b)/18)
+	for len(b) != 0 {
+		var p CompactIPv6Peer
+		copy(p.IP[:], b[:16])
+		p.Port = int(binary.BigEndian.Uint16(b[16:18]))
+		cp = append(cp, p)
+		b = b[18:]
+	}
+	return cp, nil
+}
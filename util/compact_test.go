@@ -0,0 +1,26 @@
+package util
+
+import "testing"
+
+func TestCompactPeersRoundTrip(t *testing.T) {
+	peers := CompactPeers{{[4]byte{127, 0, 0, 1}, 2}, {[4]byte{255, 0, 0, 3}, 4}}
+	b := peers.Marshal()
+	got, err := UnmarshalCompactPeers(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(peers) {
+		t.Fatalf("got %d peers, want %d", len(got), len(peers))
+	}
+	for i := range peers {
+		if got[i] != peers[i] {
+			t.Fatalf("peer %d: got %+v, want %+v", i, got[i], peers[i])
+		}
+	}
+}
+
+func TestUnmarshalCompactPeersBadLength(t *testing.T) {
+	if _, err := UnmarshalCompactPeers([]byte{1, 2, 3}); err == nil {
+		t.Fatal("expected error for bad length")
+	}
+}